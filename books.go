@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Toto35711/go-graphql-app/schemagen"
+)
+
+var bookFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "BookFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":         &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"author":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"createdAfter":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		"createdBefore": &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+	},
+})
+
+var bookSortEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "BookSort",
+	Values: graphql.EnumValueConfigMap{
+		"TITLE_ASC":    &graphql.EnumValueConfig{Value: "title_asc"},
+		"TITLE_DESC":   &graphql.EnumValueConfig{Value: "title_desc"},
+		"CREATED_ASC":  &graphql.EnumValueConfig{Value: "created_asc"},
+		"CREATED_DESC": &graphql.EnumValueConfig{Value: "created_desc"},
+	},
+})
+
+func sortDocumentFor(sort string) bson.D {
+	switch sort {
+	case "title_asc":
+		return bson.D{{Key: "title", Value: 1}}
+	case "title_desc":
+		return bson.D{{Key: "title", Value: -1}}
+	case "created_desc":
+		return bson.D{{Key: "createdAt", Value: -1}}
+	default:
+		return bson.D{{Key: "createdAt", Value: 1}}
+	}
+}
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"endCursor":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+func encodeCursor(id primitive.ObjectID) string {
+	return base64.StdEncoding.EncodeToString([]byte(id.Hex()))
+}
+
+func decodeCursor(cursor string) (primitive.ObjectID, error) {
+	raw, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return primitive.ObjectIDFromHex(string(raw))
+}
+
+// buildBooksField builds the Relay-style "books" connection field.
+// bookType is only known once schemagen has generated it during init, so
+// BookEdge/BookConnection (which embed it) are built here rather than as
+// eagerly-initialized package vars.
+func buildBooksField() *graphql.Field {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BookEdge",
+		Fields: graphql.Fields{
+			"node":   &graphql.Field{Type: bookType},
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BookConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewList(edgeType)},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+
+	return &graphql.Field{
+		Type: connectionType,
+		Args: graphql.FieldConfigArgument{
+			"filter": &graphql.ArgumentConfig{Type: bookFilterType},
+			"sort":   &graphql.ArgumentConfig{Type: bookSortEnum},
+			"first":  &graphql.ArgumentConfig{Type: graphql.Int},
+			"after":  &graphql.ArgumentConfig{Type: graphql.String},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			filter := bson.M{}
+			if raw, ok := p.Args["filter"].(map[string]interface{}); ok {
+				if title, ok := raw["title"].(string); ok && title != "" {
+					filter["title"] = bson.M{"$regex": title, "$options": "i"}
+				}
+				if author, ok := raw["author"].(string); ok && author != "" {
+					filter["author"] = bson.M{"$regex": author, "$options": "i"}
+				}
+
+				createdAt := bson.M{}
+				if after, ok := raw["createdAfter"].(time.Time); ok {
+					createdAt["$gte"] = after
+				}
+				if before, ok := raw["createdBefore"].(time.Time); ok {
+					createdAt["$lte"] = before
+				}
+				if len(createdAt) > 0 {
+					filter["createdAt"] = createdAt
+				}
+			}
+
+			sortDoc := bson.D{{Key: "createdAt", Value: 1}}
+			if sortArg, ok := p.Args["sort"].(string); ok {
+				sortDoc = sortDocumentFor(sortArg)
+			}
+
+			limit := int64(20)
+			if first, ok := p.Args["first"].(int); ok && first > 0 {
+				limit = int64(first)
+			}
+			if after, ok := p.Args["after"].(string); ok && after != "" {
+				id, err := decodeCursor(after)
+				if err != nil {
+					return nil, fmt.Errorf("invalid cursor: %w", err)
+				}
+				filter["_id"] = bson.M{"$gt": id}
+			}
+
+			opts := options.Find().SetSort(sortDoc).SetLimit(limit + 1)
+			cursor, err := booksCollection.Find(context.Background(), filter, opts)
+			if err != nil {
+				return nil, err
+			}
+			defer cursor.Close(context.Background())
+
+			var books []Book
+			if err := cursor.All(context.Background(), &books); err != nil {
+				return nil, err
+			}
+
+			hasNextPage := int64(len(books)) > limit
+			if hasNextPage {
+				books = books[:limit]
+			}
+
+			edges := make([]map[string]interface{}, len(books))
+			for i, book := range books {
+				edges[i] = map[string]interface{}{"node": book, "cursor": encodeCursor(book.ID)}
+			}
+
+			endCursor := ""
+			if len(books) > 0 {
+				endCursor = encodeCursor(books[len(books)-1].ID)
+			}
+
+			return map[string]interface{}{
+				"edges": edges,
+				"pageInfo": map[string]interface{}{
+					"hasNextPage": hasNextPage,
+					"endCursor":   endCursor,
+				},
+			}, nil
+		},
+	}
+}
+
+// buildUpdateBookField replaces schemagen's generic updateBook mutation
+// with one that requires the caller to own the book, and stamps
+// updatedAt, since the generic mutation has no notion of either.
+func buildUpdateBookField(bookInputType *graphql.InputObject) *graphql.Field {
+	return &graphql.Field{
+		Type: bookType,
+		Args: graphql.FieldConfigArgument{
+			"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(schemagen.ObjectIDScalar)},
+			"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(bookInputType)},
+		},
+		Resolve: requireAuth("", func(p graphql.ResolveParams) (interface{}, error) {
+			user := userFromContext(p.Context)
+			id, _ := p.Args["id"].(primitive.ObjectID)
+			input, ok := p.Args["input"].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("invalid input format")
+			}
+
+			set := bson.M{"updatedAt": time.Now()}
+			if title, ok := input["title"].(string); ok {
+				set["title"] = title
+			}
+			if author, ok := input["author"].(string); ok {
+				set["author"] = author
+			}
+
+			after := options.After
+			var book Book
+			err := booksCollection.FindOneAndUpdate(
+				context.Background(), bson.M{"_id": id, "ownerId": user.ID}, bson.M{"$set": set},
+				&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+			).Decode(&book)
+			if err == mongo.ErrNoDocuments {
+				return nil, errors.New("book not found")
+			}
+			if err != nil {
+				return nil, err
+			}
+			return book, nil
+		}),
+	}
+}
+
+// buildDeleteBookField replaces schemagen's generic deleteBook mutation
+// with one that requires the caller to own the book, the same way
+// buildUpdateBookField overrides updateBook.
+func buildDeleteBookField() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(schemagen.ObjectIDScalar)},
+		},
+		Resolve: requireAuth("", func(p graphql.ResolveParams) (interface{}, error) {
+			user := userFromContext(p.Context)
+			id, _ := p.Args["id"].(primitive.ObjectID)
+
+			res, err := booksCollection.DeleteOne(context.Background(), bson.M{"_id": id, "ownerId": user.ID})
+			if err != nil {
+				return nil, err
+			}
+			return res.DeletedCount > 0, nil
+		}),
+	}
+}
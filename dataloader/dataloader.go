@@ -0,0 +1,183 @@
+// Package dataloader batches and caches reads keyed by K within a single
+// request, coalescing keys requested close together into one BatchFn
+// call instead of one round-trip per key.
+//
+// graphql-go resolves a selection set's fields synchronously in a single
+// goroutine (see completeListValue/dethunkMapBreadthFirst in its
+// executor), so there is no "tick" during which concurrent Load calls
+// naturally pile up the way there would be against a real event loop.
+// Instead, callers resolving a list of sibling fields must use LoadThunk:
+// it registers the key and returns immediately without blocking, so a
+// resolver can hand back a `func() (interface{}, error)` thunk. graphql-go
+// calls every sibling's Resolve (and so every LoadThunk) to collect their
+// thunks before invoking any of them, which is what gives the batch a
+// chance to accumulate more than one key before the first thunk blocks on
+// its result. Load is a convenience wrapper for callers that don't need
+// that and are fine resolving one key at a time.
+package dataloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchFn resolves many keys in a single call. values and errs must each
+// be the same length as keys and positionally aligned with it.
+type BatchFn[K comparable, V any] func(keys []K) (values []V, errs []error)
+
+// Config controls how a Loader batches.
+type Config struct {
+	// MaxBatch caps how many keys accumulate before BatchFn fires early.
+	// Zero means no cap; the batch only ever fires on the Wait timer.
+	MaxBatch int
+	// Wait is how long to accumulate keys before dispatching a batch that
+	// hasn't hit MaxBatch. It only needs to be long enough for a caller to
+	// finish calling LoadThunk for every sibling field before the first
+	// returned thunk blocks waiting on it.
+	Wait time.Duration
+}
+
+type result[V any] struct {
+	value V
+	err   error
+}
+
+type pendingLoad[K comparable, V any] struct {
+	key     K
+	waiters []chan result[V]
+}
+
+// Loader coalesces Load/LoadThunk calls for the same key made before a
+// batch dispatches, and caches every key's result for the Loader's
+// lifetime (typically one GraphQL request).
+type Loader[K comparable, V any] struct {
+	batch  BatchFn[K, V]
+	config Config
+
+	mu      sync.Mutex
+	cache   map[K]result[V]
+	pending []pendingLoad[K, V]
+	timer   *time.Timer
+}
+
+func NewLoader[K comparable, V any](batch BatchFn[K, V], config Config) *Loader[K, V] {
+	if config.Wait <= 0 {
+		config.Wait = time.Millisecond
+	}
+	return &Loader[K, V]{
+		batch:  batch,
+		config: config,
+		cache:  make(map[K]result[V]),
+	}
+}
+
+// LoadThunk registers key against the in-flight batch (joining an
+// existing pending entry for the same key rather than adding a
+// duplicate) and returns a thunk that blocks until that batch has
+// dispatched and resolved. Registration itself never blocks, so a
+// resolver can call LoadThunk and return its result as a thunk instead of
+// calling it inline — see the package doc for why that's what actually
+// lets keys batch together under graphql-go's executor.
+func (l *Loader[K, V]) LoadThunk(ctx context.Context, key K) func() (V, error) {
+	waiter := l.register(key)
+	return func() (V, error) {
+		select {
+		case res := <-waiter:
+			return res.value, res.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Load registers key and blocks until it resolves. Equivalent to
+// l.LoadThunk(ctx, key)() — prefer LoadThunk when resolving a list of
+// sibling fields so every key is registered before any one of them
+// blocks.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	return l.LoadThunk(ctx, key)()
+}
+
+func (l *Loader[K, V]) register(key K) chan result[V] {
+	l.mu.Lock()
+	if cached, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		done := make(chan result[V], 1)
+		done <- cached
+		return done
+	}
+
+	// Multiple registrations for the same key before the batch dispatches
+	// (e.g. two books in the same list sharing an owner) join the same
+	// pendingLoad entry instead of each adding a duplicate key to the
+	// batch.
+	waiter := make(chan result[V], 1)
+	joined := false
+	for i := range l.pending {
+		if l.pending[i].key == key {
+			l.pending[i].waiters = append(l.pending[i].waiters, waiter)
+			joined = true
+			break
+		}
+	}
+	if !joined {
+		l.pending = append(l.pending, pendingLoad[K, V]{key: key, waiters: []chan result[V]{waiter}})
+	}
+
+	if l.config.MaxBatch > 0 && len(l.pending) >= l.config.MaxBatch {
+		batch := l.pending
+		l.pending = nil
+		if l.timer != nil {
+			l.timer.Stop()
+			l.timer = nil
+		}
+		l.mu.Unlock()
+		l.dispatch(batch)
+	} else {
+		if l.timer == nil {
+			l.timer = time.AfterFunc(l.config.Wait, l.dispatchPending)
+		}
+		l.mu.Unlock()
+	}
+
+	return waiter
+}
+
+func (l *Loader[K, V]) dispatchPending() {
+	l.mu.Lock()
+	batch := l.pending
+	l.pending = nil
+	l.timer = nil
+	l.mu.Unlock()
+	l.dispatch(batch)
+}
+
+func (l *Loader[K, V]) dispatch(batch []pendingLoad[K, V]) {
+	if len(batch) == 0 {
+		return
+	}
+
+	keys := make([]K, len(batch))
+	for i, load := range batch {
+		keys[i] = load.key
+	}
+	values, errs := l.batch(keys)
+
+	l.mu.Lock()
+	for i, load := range batch {
+		var res result[V]
+		if i < len(values) {
+			res.value = values[i]
+		}
+		if i < len(errs) {
+			res.err = errs[i]
+		}
+		l.cache[load.key] = res
+		for _, w := range load.waiters {
+			w <- res
+		}
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,159 @@
+package dataloader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func batchDouble(calls *int32, mu *sync.Mutex, sizes *[]int) BatchFn[int, int] {
+	return func(keys []int) ([]int, []error) {
+		mu.Lock()
+		*calls++
+		*sizes = append(*sizes, len(keys))
+		mu.Unlock()
+
+		values := make([]int, len(keys))
+		errs := make([]error, len(keys))
+		for i, k := range keys {
+			values[i] = k * 2
+		}
+		return values, errs
+	}
+}
+
+func TestLoadThunkBatchesConcurrentCallsBeforeBlocking(t *testing.T) {
+	var mu sync.Mutex
+	var calls int32
+	var sizes []int
+	loader := NewLoader(batchDouble(&calls, &mu, &sizes), Config{Wait: 10 * time.Millisecond})
+
+	ctx := context.Background()
+	thunks := make([]func() (int, error), 20)
+	for i := range thunks {
+		// Registering every key before blocking on any of them is what
+		// lets them land in the same batch, mirroring how a resolver
+		// returns a thunk instead of calling Load inline.
+		thunks[i] = loader.LoadThunk(ctx, i)
+	}
+
+	for i, thunk := range thunks {
+		v, err := thunk()
+		if err != nil {
+			t.Fatalf("thunk(%d) returned error: %v", i, err)
+		}
+		if v != i*2 {
+			t.Errorf("thunk(%d) = %d, want %d", i, v, i*2)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("batch function called %d times, want 1 (all 20 keys should have joined one batch)", calls)
+	}
+	if len(sizes) == 1 && sizes[0] != 20 {
+		t.Errorf("batch size = %d, want 20", sizes[0])
+	}
+}
+
+func TestLoadDedupsConcurrentCallsForTheSameKey(t *testing.T) {
+	var mu sync.Mutex
+	var calls int32
+	var sizes []int
+	loader := NewLoader(batchDouble(&calls, &mu, &sizes), Config{Wait: 10 * time.Millisecond})
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	results := make([]int, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := loader.Load(ctx, 7)
+			if err != nil {
+				t.Errorf("Load(7) returned error: %v", err)
+				return
+			}
+			results[i] = v
+		}(i)
+	}
+	wg.Wait()
+
+	for i, v := range results {
+		if v != 14 {
+			t.Errorf("results[%d] = %d, want 14", i, v)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("batch function called %d times, want 1 (five concurrent loads of the same key should dedup)", calls)
+	}
+	if len(sizes) == 1 && sizes[0] != 1 {
+		t.Errorf("batch size = %d, want 1 (a single key, not one entry per waiter)", sizes[0])
+	}
+}
+
+func TestLoadCachesAcrossCalls(t *testing.T) {
+	var mu sync.Mutex
+	var calls int32
+	var sizes []int
+	loader := NewLoader(batchDouble(&calls, &mu, &sizes), Config{Wait: time.Millisecond})
+
+	ctx := context.Background()
+	if v, err := loader.Load(ctx, 3); err != nil || v != 6 {
+		t.Fatalf("Load(3) = (%d, %v), want (6, nil)", v, err)
+	}
+	if v, err := loader.Load(ctx, 3); err != nil || v != 6 {
+		t.Fatalf("second Load(3) = (%d, %v), want (6, nil)", v, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("batch function called %d times, want 1 (second Load should hit the cache)", calls)
+	}
+}
+
+func TestLoadThunkDispatchesEarlyAtMaxBatch(t *testing.T) {
+	var mu sync.Mutex
+	var calls int32
+	var sizes []int
+	loader := NewLoader(batchDouble(&calls, &mu, &sizes), Config{MaxBatch: 2, Wait: time.Hour})
+
+	ctx := context.Background()
+	t1 := loader.LoadThunk(ctx, 1)
+	t2 := loader.LoadThunk(ctx, 2)
+
+	if v, err := t1(); err != nil || v != 2 {
+		t.Fatalf("thunk(1) = (%d, %v), want (2, nil)", v, err)
+	}
+	if v, err := t2(); err != nil || v != 4 {
+		t.Fatalf("thunk(2) = (%d, %v), want (4, nil)", v, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("batch function called %d times, want 1 (hitting MaxBatch should dispatch without waiting for the timer)", calls)
+	}
+}
+
+func TestLoadThunkReturnsBatchError(t *testing.T) {
+	failing := func(keys []int) ([]int, []error) {
+		errs := make([]error, len(keys))
+		for i := range keys {
+			errs[i] = fmt.Errorf("key %d not found", keys[i])
+		}
+		return make([]int, len(keys)), errs
+	}
+	loader := NewLoader[int, int](failing, Config{Wait: time.Millisecond})
+
+	if _, err := loader.Load(context.Background(), 9); err == nil {
+		t.Fatal("expected an error from a batch function that fails every key")
+	}
+}
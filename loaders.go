@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Toto35711/go-graphql-app/dataloader"
+)
+
+type loaderContextKey string
+
+const loadersContextKey loaderContextKey = "loaders"
+
+// requestLoaders holds the DataLoaders for a single GraphQL operation. A
+// fresh set is created per request so batching and caching never leak
+// across requests.
+type requestLoaders struct {
+	bookByID     *dataloader.Loader[primitive.ObjectID, Book]
+	userByID     *dataloader.Loader[primitive.ObjectID, User]
+	booksByOwner *dataloader.Loader[primitive.ObjectID, []Book]
+}
+
+const loaderMaxBatch = 100
+
+func newRequestLoaders() *requestLoaders {
+	cfg := dataloader.Config{MaxBatch: loaderMaxBatch, Wait: time.Millisecond}
+	return &requestLoaders{
+		bookByID:     dataloader.NewLoader(batchBooksByID, cfg),
+		userByID:     dataloader.NewLoader(batchUsersByID, cfg),
+		booksByOwner: dataloader.NewLoader(batchBooksByOwner, cfg),
+	}
+}
+
+// withLoaders attaches a fresh requestLoaders to ctx for graphql.Do to
+// carry through graphql.Params.Context to every resolver in the request.
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersContextKey, newRequestLoaders())
+}
+
+func loadersFromContext(ctx context.Context) *requestLoaders {
+	loaders, _ := ctx.Value(loadersContextKey).(*requestLoaders)
+	return loaders
+}
+
+func batchBooksByID(ids []primitive.ObjectID) ([]Book, []error) {
+	cursor, err := booksCollection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return make([]Book, len(ids)), fillErr(len(ids), err)
+	}
+	defer cursor.Close(context.Background())
+
+	var books []Book
+	if err := cursor.All(context.Background(), &books); err != nil {
+		return make([]Book, len(ids)), fillErr(len(ids), err)
+	}
+
+	byID := make(map[primitive.ObjectID]Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	values := make([]Book, len(ids))
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		if b, ok := byID[id]; ok {
+			values[i] = b
+		} else {
+			errs[i] = fmt.Errorf("book %s not found", id.Hex())
+		}
+	}
+	return values, errs
+}
+
+func batchUsersByID(ids []primitive.ObjectID) ([]User, []error) {
+	cursor, err := usersCollection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return make([]User, len(ids)), fillErr(len(ids), err)
+	}
+	defer cursor.Close(context.Background())
+
+	var users []User
+	if err := cursor.All(context.Background(), &users); err != nil {
+		return make([]User, len(ids)), fillErr(len(ids), err)
+	}
+
+	byID := make(map[primitive.ObjectID]User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	values := make([]User, len(ids))
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		if u, ok := byID[id]; ok {
+			values[i] = u
+		} else {
+			errs[i] = fmt.Errorf("user %s not found", id.Hex())
+		}
+	}
+	return values, errs
+}
+
+func batchBooksByOwner(ownerIDs []primitive.ObjectID) ([][]Book, []error) {
+	cursor, err := booksCollection.Find(context.Background(), bson.M{"ownerId": bson.M{"$in": ownerIDs}})
+	if err != nil {
+		return make([][]Book, len(ownerIDs)), fillErr(len(ownerIDs), err)
+	}
+	defer cursor.Close(context.Background())
+
+	var books []Book
+	if err := cursor.All(context.Background(), &books); err != nil {
+		return make([][]Book, len(ownerIDs)), fillErr(len(ownerIDs), err)
+	}
+
+	byOwner := make(map[primitive.ObjectID][]Book)
+	for _, b := range books {
+		byOwner[b.OwnerID] = append(byOwner[b.OwnerID], b)
+	}
+
+	values := make([][]Book, len(ownerIDs))
+	for i, id := range ownerIDs {
+		values[i] = byOwner[id]
+	}
+	return values, make([]error, len(ownerIDs))
+}
+
+func fillErr(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ownerField resolves Book.owner through userByID, so listing many books
+// (e.g. the "books" connection) costs one batched users query instead of
+// one per book. It returns a thunk rather than blocking inline: graphql-go
+// resolves every sibling field of a selection set (collecting thunks)
+// before invoking any of them, so registering the load here and only
+// blocking once the thunk is called is what lets sibling books' owner
+// loads actually land in the same batch. See the dataloader package doc.
+var ownerField = &graphql.Field{
+	Type: userType,
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		book, ok := p.Source.(Book)
+		if !ok {
+			return nil, nil
+		}
+		loaders := loadersFromContext(p.Context)
+		if loaders == nil {
+			return nil, errors.New("no dataloaders on request context")
+		}
+		thunk := loaders.userByID.LoadThunk(p.Context, book.OwnerID)
+		return func() (interface{}, error) {
+			return thunk()
+		}, nil
+	},
+}
+
+// buildUserBooksField resolves User.books through booksByOwner, the
+// mirror image of ownerField, returning a thunk for the same reason.
+func buildUserBooksField() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(bookType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			user, ok := p.Source.(User)
+			if !ok {
+				return nil, nil
+			}
+			loaders := loadersFromContext(p.Context)
+			if loaders == nil {
+				return nil, errors.New("no dataloaders on request context")
+			}
+			thunk := loaders.booksByOwner.LoadThunk(p.Context, user.ID)
+			return func() (interface{}, error) {
+				return thunk()
+			}, nil
+		},
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,152 +10,36 @@ import (
 
 	"github.com/graphql-go/graphql"
 	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Toto35711/go-graphql-app/schemagen"
 )
 
 type Book struct {
-	ID     primitive.ObjectID `json:"id" bson:"_id"`
-	Title  string             `json:"title" bson:"title"`
-	Author string             `json:"author" bson:"author"`
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Title     string             `json:"title" bson:"title"`
+	Author    string             `json:"author" bson:"author"`
+	OwnerID   primitive.ObjectID `json:"-" bson:"ownerId" graphql:"-"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt" graphql:"readonly"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt" graphql:"readonly"`
 }
 
-var rootQuery = graphql.NewObject(
-	graphql.ObjectConfig{
-		Name: "RootQuery",
-		Fields: graphql.Fields{
-			"book": &graphql.Field{
-				Type: graphql.NewObject(
-					graphql.ObjectConfig{
-						Name: "Book",
-						Fields: graphql.Fields{
-							"id":     &graphql.Field{Type: graphql.String},
-							"title":  &graphql.Field{Type: graphql.String},
-							"author": &graphql.Field{Type: graphql.String},
-						},
-					},
-				),
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{Type: graphql.String},
-				},
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					id, ok := p.Args["id"].(string)
-					if ok {
-						filter := bson.M{"_id": id}
-						var result Book
-						err := booksCollection.FindOne(context.Background(), filter).Decode(&result)
-						if err != nil {
-							log.Printf("Error finding book by ID: %v", err)
-							return nil, err
-						}
-						return result, nil
-					}
-					return nil, nil
-				},
-			},
-			"books": &graphql.Field{
-				Type: graphql.NewList(
-					graphql.NewObject(
-						graphql.ObjectConfig{
-							Name: "Book",
-							Fields: graphql.Fields{
-								"id":     &graphql.Field{Type: graphql.String},
-								"title":  &graphql.Field{Type: graphql.String},
-								"author": &graphql.Field{Type: graphql.String},
-							},
-						},
-					),
-				),
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					cursor, err := booksCollection.Find(context.Background(), bson.M{})
-					if err != nil {
-						log.Printf("Error finding books: %v", err)
-						return nil, err
-					}
-					defer cursor.Close(context.Background())
-
-					var results []Book
-					if err := cursor.All(context.Background(), &results); err != nil {
-						log.Printf("Error decoding books: %v", err)
-						return nil, err
-					}
-					return results, nil
-				},
-			},
-		},
-	},
-)
-
-var bookType = graphql.NewObject(
-	graphql.ObjectConfig{
-		Name: "Book",
-		Fields: graphql.Fields{
-			"id":     &graphql.Field{Type: graphql.String},
-			"title":  &graphql.Field{Type: graphql.String},
-			"author": &graphql.Field{Type: graphql.String},
-		},
-	},
-)
-
-var bookInputType = graphql.NewInputObject(
-	graphql.InputObjectConfig{
-		Name: "BookInput",
-		Fields: graphql.InputObjectConfigFieldMap{
-			"title":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
-			"author": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
-		},
-	},
+// registry is the single source of truth for which Go structs are exposed
+// over GraphQL. Removing a Register call below removes that type's
+// generated queries and mutations from the schema. Book is the exception:
+// init also builds hand-written fields, the User.books field and the
+// Subscription type on bookType, so unregistering Book leaves bookType nil
+// and init fails unless those are removed too.
+var registry = schemagen.NewRegistry()
+
+var (
+	booksCollection *mongo.Collection
+	bookType        *graphql.Object
+	schema          graphql.Schema
 )
 
-var mutation = graphql.NewObject(
-	graphql.ObjectConfig{
-		Name: "Mutation",
-		Fields: graphql.Fields{
-			"createBook": &graphql.Field{
-				Type: bookType,
-				Args: graphql.FieldConfigArgument{
-					"input": &graphql.ArgumentConfig{
-						Type: bookInputType,
-					},
-				},
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					input, ok := p.Args["input"].(map[string]interface{})
-					if !ok {
-						return nil, errors.New("invalid input format")
-					}
-
-					newBook := Book{
-						ID:     primitive.NewObjectID(),
-						Title:  input["title"].(string),
-						Author: input["author"].(string),
-					}
-
-					result, err := booksCollection.InsertOne(context.Background(), newBook)
-					if err != nil {
-						log.Printf("Error creating a new book: %v", err)
-						return nil, err
-					}
-
-					newBook.ID = result.InsertedID.(primitive.ObjectID)
-
-					return newBook, nil
-				},
-			},
-		},
-	},
-)
-
-var schema, _ = graphql.NewSchema(
-	graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: mutation,
-	},
-)
-
-var booksCollection *mongo.Collection
-
 func init() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file")
@@ -183,33 +65,40 @@ func init() {
 	}
 
 	booksCollection = client.Database("graphql").Collection("books")
-}
-
-func graphqlHandler(w http.ResponseWriter, r *http.Request) {
-	var requestBody map[string]interface{}
-
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	persistedQueriesCollection = client.Database("graphql").Collection("persisted_queries")
+	usersCollection = client.Database("graphql").Collection("users")
+	ensureUserIndexes()
+
+	registry.Register("Book", Book{}, booksCollection)
+	rootQuery, mutation := registry.Build()
+	bookType = registry.ObjectType(Book{})
+	bookInputType := registry.InputType(Book{})
+
+	bookType.AddFieldConfig("owner", ownerField)
+	userType.AddFieldConfig("books", buildUserBooksField())
+
+	rootQuery.AddFieldConfig("me", meField)
+	rootQuery.AddFieldConfig("myBooks", buildMyBooksField())
+	rootQuery.AddFieldConfig("books", buildBooksField())
+	mutation.AddFieldConfig("signup", signupField)
+	mutation.AddFieldConfig("login", loginField)
+	mutation.AddFieldConfig("createBook", buildCreateBookField(bookInputType))
+	mutation.AddFieldConfig("updateBook", buildUpdateBookField(bookInputType))
+	mutation.AddFieldConfig("deleteBook", buildDeleteBookField())
+
+	schema, err = graphql.NewSchema(graphql.SchemaConfig{
+		Query:        rootQuery,
+		Mutation:     mutation,
+		Subscription: buildSubscriptionType(bookType),
+	})
 	if err != nil {
-		http.Error(w, "Error decoding request body", http.StatusBadRequest)
-		return
-	}
-
-	query, exists := requestBody["query"].(string)
-	if !exists || query == "" {
-		http.Error(w, "Must provide a GraphQL query", http.StatusBadRequest)
-		return
+		log.Fatal(err)
 	}
-
-	result := graphql.Do(graphql.Params{
-		Schema:        schema,
-		RequestString: query,
-	})
-
-	json.NewEncoder(w).Encode(result)
 }
 
 func main() {
-	http.HandleFunc("/graphql", graphqlHandler)
+	http.HandleFunc("/graphql", authMiddleware(graphqlHandler))
+	http.HandleFunc("/graphql/ws", graphqlWSHandler)
 	fmt.Println("Server is running on http://localhost:8080/graphql")
 	log.Fatal(http.ListenAndServe(":8070", nil))
 }
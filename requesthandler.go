@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gqlRequest is the standard GraphQL-over-HTTP request shape, shared by
+// the GET, single-operation POST, and batched POST paths.
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+const persistedQueryNotFoundMessage = "PersistedQueryNotFound"
+
+// persistedQueryDoc is the Mongo-backed record behind pqCache, so
+// Automatic Persisted Queries survive a server restart.
+type persistedQueryDoc struct {
+	Hash  string `bson:"_id"`
+	Query string `bson:"query"`
+}
+
+var persistedQueriesCollection *mongo.Collection
+
+// pqCache is a small in-memory LRU in front of persistedQueriesCollection
+// so repeat lookups of the same hash don't round-trip to Mongo.
+type pqCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type pqEntry struct {
+	hash  string
+	query string
+}
+
+func newPQCache(capacity int) *pqCache {
+	return &pqCache{capacity: capacity, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *pqCache) get(hash string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[hash]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*pqEntry).query, true
+	}
+	return "", false
+}
+
+func (c *pqCache) set(hash, query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[hash]; ok {
+		el.Value.(*pqEntry).query = query
+		c.ll.MoveToFront(el)
+		return
+	}
+	el := c.ll.PushFront(&pqEntry{hash: hash, query: query})
+	c.items[hash] = el
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*pqEntry).hash)
+		}
+	}
+}
+
+var persistedQueries = newPQCache(1000)
+
+func lookupPersistedQuery(hash string) (string, bool) {
+	if query, ok := persistedQueries.get(hash); ok {
+		return query, true
+	}
+	if persistedQueriesCollection == nil {
+		return "", false
+	}
+
+	var doc persistedQueryDoc
+	if err := persistedQueriesCollection.FindOne(context.Background(), bson.M{"_id": hash}).Decode(&doc); err != nil {
+		return "", false
+	}
+	persistedQueries.set(hash, doc.Query)
+	return doc.Query, true
+}
+
+func storePersistedQuery(hash, query string) {
+	persistedQueries.set(hash, query)
+	if persistedQueriesCollection == nil {
+		return
+	}
+
+	_, err := persistedQueriesCollection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": hash},
+		bson.M{"$setOnInsert": persistedQueryDoc{Hash: hash, Query: query}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("storing persisted query %s: %v", hash, err)
+	}
+}
+
+// applyPersistedQuery implements Apollo's Automatic Persisted Queries
+// protocol. When req has no extensions.persistedQuery it is a no-op. When
+// the client sent only a hash, it fills in req.Query from the store, or
+// returns PersistedQueryNotFound so the client resends with the full
+// query. When the client sent query+hash, it verifies and stores them.
+// ok is false when the caller should return the returned result as-is
+// without executing anything.
+func applyPersistedQuery(req *gqlRequest) (result *graphql.Result, ok bool) {
+	raw, exists := req.Extensions["persistedQuery"]
+	if !exists {
+		return nil, true
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, true
+	}
+	var ext persistedQueryExtension
+	if err := json.Unmarshal(b, &ext); err != nil || ext.Sha256Hash == "" {
+		return nil, true
+	}
+
+	if req.Query == "" {
+		query, found := lookupPersistedQuery(ext.Sha256Hash)
+		if !found {
+			return &graphql.Result{
+				Errors: []gqlerrors.FormattedError{{Message: persistedQueryNotFoundMessage}},
+			}, false
+		}
+		req.Query = query
+		return nil, true
+	}
+
+	sum := sha256.Sum256([]byte(req.Query))
+	if hex.EncodeToString(sum[:]) != ext.Sha256Hash {
+		return &graphql.Result{
+			Errors: []gqlerrors.FormattedError{{Message: "provided sha256Hash does not match query"}},
+		}, false
+	}
+	storePersistedQuery(ext.Sha256Hash, req.Query)
+	return nil, true
+}
+
+func executeOperation(ctx context.Context, req gqlRequest) *graphql.Result {
+	if result, ok := applyPersistedQuery(&req); !ok {
+		return result
+	}
+	if req.Query == "" {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "Must provide a GraphQL query"}}}
+	}
+
+	return graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        withLoaders(ctx),
+	})
+}
+
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleGraphQLGet(w, r)
+	case http.MethodPost:
+		handleGraphQLPost(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleGraphQLGet(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	req := gqlRequest{
+		Query:         params.Get("query"),
+		OperationName: params.Get("operationName"),
+	}
+	if v := params.Get("variables"); v != "" {
+		if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+			http.Error(w, "Invalid variables parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if e := params.Get("extensions"); e != "" {
+		if err := json.Unmarshal([]byte(e), &req.Extensions); err != nil {
+			http.Error(w, "Invalid extensions parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	writeGraphQLResult(w, executeOperation(r.Context(), req))
+}
+
+func handleGraphQLPost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+		writeGraphQLResult(w, executeOperation(r.Context(), gqlRequest{Query: string(body)}))
+		return
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []gqlRequest
+		if err := json.Unmarshal(trimmed, &batch); err != nil {
+			http.Error(w, "Error decoding request body", http.StatusBadRequest)
+			return
+		}
+
+		results := make([]*graphql.Result, len(batch))
+		for i, op := range batch {
+			results[i] = executeOperation(r.Context(), op)
+		}
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
+	var req gqlRequest
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+	writeGraphQLResult(w, executeOperation(r.Context(), req))
+}
+
+func writeGraphQLResult(w http.ResponseWriter, result *graphql.Result) {
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,423 @@
+// Package schemagen builds a GraphQL schema for arbitrary Mongo-backed Go
+// structs by reflection: register a struct and its *mongo.Collection, and
+// get<T>/list<T> queries plus create<T>/update<T>/delete<T> mutations fall
+// out with no hand-written resolvers or type declarations.
+package schemagen
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// ObjectIDScalar is the GraphQL "ID" scalar. It coerces between a hex
+// string on the wire and primitive.ObjectID in Go so generated fields and
+// arguments never need per-type conversion code.
+var ObjectIDScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "ID",
+	Description: "A hex-encoded MongoDB ObjectID.",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case primitive.ObjectID:
+			return v.Hex()
+		case string:
+			return v
+		default:
+			return nil
+		}
+	},
+	ParseValue: func(value interface{}) interface{} {
+		s, ok := value.(string)
+		if !ok {
+			return nil
+		}
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return nil
+		}
+		return id
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		lit, ok := valueAST.(*ast.StringValue)
+		if !ok {
+			return nil
+		}
+		id, err := primitive.ObjectIDFromHex(lit.Value)
+		if err != nil {
+			return nil
+		}
+		return id
+	},
+})
+
+// Entry binds a Go struct to the Mongo collection that stores it.
+type Entry struct {
+	Name       string
+	GoType     reflect.Type
+	Collection *mongo.Collection
+}
+
+// Registry is the set of structs schemagen turns into a GraphQL schema.
+type Registry struct {
+	entries []Entry
+	objects map[reflect.Type]*graphql.Object
+	inputs  map[reflect.Type]*graphql.InputObject
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		objects: make(map[reflect.Type]*graphql.Object),
+		inputs:  make(map[reflect.Type]*graphql.InputObject),
+	}
+}
+
+// Register adds a struct (given as a zero value, e.g. Book{}) backed by
+// coll to the registry. Removing the Register call removes the type from
+// the schema entirely.
+func (r *Registry) Register(name string, sample interface{}, coll *mongo.Collection) {
+	t := reflect.TypeOf(sample)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	r.entries = append(r.entries, Entry{Name: name, GoType: t, Collection: coll})
+}
+
+// ObjectType returns the generated graphql.Object for a registered struct,
+// for callers that need to reference it directly (e.g. to embed it in a
+// hand-written field elsewhere in the schema). It is only populated once
+// the type has gone through Build.
+func (r *Registry) ObjectType(sample interface{}) *graphql.Object {
+	t := reflect.TypeOf(sample)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return r.objects[t]
+}
+
+// InputType returns the generated "<T>Input" graphql.InputObject for a
+// registered struct, for callers building a hand-written field (e.g. a
+// custom mutation) that takes the same input shape as the generated
+// create/update mutations. It is only populated once the type has gone
+// through Build.
+func (r *Registry) InputType(sample interface{}) *graphql.InputObject {
+	t := reflect.TypeOf(sample)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return r.inputs[t]
+}
+
+// Build generates the RootQuery and Mutation objects for every registered
+// entry.
+func (r *Registry) Build() (*graphql.Object, *graphql.Object) {
+	queryFields := graphql.Fields{}
+	mutationFields := graphql.Fields{}
+
+	for _, entry := range r.entries {
+		entry := entry
+		objType := r.objectTypeFor(entry.GoType)
+		inputType := r.inputTypeFor(entry.GoType)
+		idField := idFieldOf(entry.GoType)
+
+		queryFields["get"+entry.Name] = &graphql.Field{
+			Type: objType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(ObjectIDScalar)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["id"].(primitive.ObjectID)
+				result := reflect.New(entry.GoType).Interface()
+				if err := entry.Collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(result); err != nil {
+					return nil, err
+				}
+				return reflect.ValueOf(result).Elem().Interface(), nil
+			},
+		}
+
+		queryFields["list"+entry.Name] = &graphql.Field{
+			Type: graphql.NewList(objType),
+			Args: graphql.FieldConfigArgument{
+				"filter": &graphql.ArgumentConfig{Type: inputType},
+				"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
+				"skip":   &graphql.ArgumentConfig{Type: graphql.Int},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				filter := bson.M{}
+				if raw, ok := p.Args["filter"].(map[string]interface{}); ok {
+					filter = toBSONFilter(entry.GoType, raw)
+				}
+
+				opts := options.Find()
+				if limit, ok := p.Args["limit"].(int); ok {
+					opts.SetLimit(int64(limit))
+				}
+				if skip, ok := p.Args["skip"].(int); ok {
+					opts.SetSkip(int64(skip))
+				}
+
+				cursor, err := entry.Collection.Find(context.Background(), filter, opts)
+				if err != nil {
+					return nil, err
+				}
+				defer cursor.Close(context.Background())
+
+				slice := reflect.New(reflect.SliceOf(entry.GoType)).Interface()
+				if err := cursor.All(context.Background(), slice); err != nil {
+					return nil, err
+				}
+				return reflect.ValueOf(slice).Elem().Interface(), nil
+			},
+		}
+
+		mutationFields["create"+entry.Name] = &graphql.Field{
+			Type: objType,
+			Args: graphql.FieldConfigArgument{
+				"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(inputType)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				input, _ := p.Args["input"].(map[string]interface{})
+				doc := toBSONFilter(entry.GoType, input)
+				if idField != "" {
+					doc[idField] = primitive.NewObjectID()
+				}
+
+				res, err := entry.Collection.InsertOne(context.Background(), doc)
+				if err != nil {
+					return nil, err
+				}
+
+				result := reflect.New(entry.GoType).Interface()
+				if err := entry.Collection.FindOne(context.Background(), bson.M{"_id": res.InsertedID}).Decode(result); err != nil {
+					return nil, err
+				}
+				return reflect.ValueOf(result).Elem().Interface(), nil
+			},
+		}
+
+		mutationFields["update"+entry.Name] = &graphql.Field{
+			Type: objType,
+			Args: graphql.FieldConfigArgument{
+				"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(ObjectIDScalar)},
+				"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(inputType)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["id"].(primitive.ObjectID)
+				input, _ := p.Args["input"].(map[string]interface{})
+				update := bson.M{"$set": toBSONFilter(entry.GoType, input)}
+
+				after := options.After
+				result := reflect.New(entry.GoType).Interface()
+				err := entry.Collection.FindOneAndUpdate(
+					context.Background(), bson.M{"_id": id}, update,
+					&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+				).Decode(result)
+				if err != nil {
+					return nil, err
+				}
+				return reflect.ValueOf(result).Elem().Interface(), nil
+			},
+		}
+
+		mutationFields["delete"+entry.Name] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(ObjectIDScalar)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["id"].(primitive.ObjectID)
+				res, err := entry.Collection.DeleteOne(context.Background(), bson.M{"_id": id})
+				if err != nil {
+					return nil, err
+				}
+				return res.DeletedCount > 0, nil
+			},
+		}
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{Name: "RootQuery", Fields: queryFields})
+	mut := graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutationFields})
+	return query, mut
+}
+
+func (r *Registry) objectTypeFor(t reflect.Type) *graphql.Object {
+	if obj, ok := r.objects[t]; ok {
+		return obj
+	}
+
+	fields := graphql.Fields{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("graphql") == "-" {
+			continue
+		}
+		fields[jsonName(f)] = &graphql.Field{Type: r.outputTypeFor(f.Type)}
+	}
+
+	obj := graphql.NewObject(graphql.ObjectConfig{Name: t.Name(), Fields: fields})
+	r.objects[t] = obj
+	return obj
+}
+
+func (r *Registry) outputTypeFor(t reflect.Type) graphql.Output {
+	switch {
+	case t == objectIDType:
+		return ObjectIDScalar
+	case t == timeType:
+		return graphql.DateTime
+	case t.Kind() == reflect.Ptr:
+		return r.outputTypeFor(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return graphql.NewList(r.outputTypeFor(t.Elem()))
+	case t.Kind() == reflect.Struct:
+		return r.objectTypeFor(t)
+	default:
+		return scalarFor(t.Kind())
+	}
+}
+
+func (r *Registry) inputTypeFor(t reflect.Type) *graphql.InputObject {
+	if in, ok := r.inputs[t]; ok {
+		return in
+	}
+
+	fields := graphql.InputObjectConfigFieldMap{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("graphql")
+		if f.PkgPath != "" || tag == "-" || tag == "readonly" || isIDField(f) {
+			continue
+		}
+		fields[jsonName(f)] = &graphql.InputObjectFieldConfig{Type: r.inputTypeForField(f.Type)}
+	}
+
+	in := graphql.NewInputObject(graphql.InputObjectConfig{Name: t.Name() + "Input", Fields: fields})
+	r.inputs[t] = in
+	return in
+}
+
+func (r *Registry) inputTypeForField(t reflect.Type) graphql.Input {
+	switch {
+	case t == objectIDType:
+		return ObjectIDScalar
+	case t == timeType:
+		return graphql.DateTime
+	case t.Kind() == reflect.Ptr:
+		return r.inputTypeForField(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return graphql.NewList(r.inputTypeForField(t.Elem()))
+	case t.Kind() == reflect.Struct:
+		return r.inputTypeFor(t)
+	default:
+		return scalarFor(t.Kind())
+	}
+}
+
+func scalarFor(k reflect.Kind) graphql.Output {
+	switch k {
+	case reflect.String:
+		return graphql.String
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return graphql.Int
+	default:
+		return graphql.String
+	}
+}
+
+func isIDField(f reflect.StructField) bool {
+	return strings.Split(f.Tag.Get("bson"), ",")[0] == "_id"
+}
+
+func idFieldOf(t reflect.Type) string {
+	for i := 0; i < t.NumField(); i++ {
+		if isIDField(t.Field(i)) {
+			return "_id"
+		}
+	}
+	return ""
+}
+
+func jsonName(f reflect.StructField) string {
+	if tag := f.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	if tag := f.Tag.Get("bson"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			if name == "_id" {
+				return "id"
+			}
+			return name
+		}
+	}
+	return strings.ToLower(f.Name)
+}
+
+func bsonName(f reflect.StructField) string {
+	if tag := f.Tag.Get("bson"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(f.Name)
+}
+
+// toBSONFilter converts GraphQL input args (keyed by each field's
+// json/bson name as seen on the wire) into a bson.M keyed by the struct's
+// bson field names, so generated resolvers need no type-specific
+// conversion code.
+func toBSONFilter(t reflect.Type, args map[string]interface{}) bson.M {
+	out := bson.M{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("graphql") == "-" {
+			continue
+		}
+		val, ok := args[jsonName(f)]
+		if !ok {
+			continue
+		}
+		out[bsonName(f)] = coerceValue(f.Type, val)
+	}
+	return out
+}
+
+func coerceValue(t reflect.Type, val interface{}) interface{} {
+	switch {
+	case t == objectIDType:
+		if id, ok := val.(primitive.ObjectID); ok {
+			return id
+		}
+	case t.Kind() == reflect.Struct && t != timeType:
+		if m, ok := val.(map[string]interface{}); ok {
+			return toBSONFilter(t, m)
+		}
+	case t.Kind() == reflect.Slice:
+		if list, ok := val.([]interface{}); ok {
+			converted := make([]interface{}, len(list))
+			for i, item := range list {
+				converted[i] = coerceValue(t.Elem(), item)
+			}
+			return converted
+		}
+	}
+	return val
+}
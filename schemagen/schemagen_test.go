@@ -0,0 +1,107 @@
+package schemagen
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testAddress struct {
+	City string `json:"city" bson:"city"`
+}
+
+type testDoc struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Name      string             `json:"name" bson:"name"`
+	Secret    string             `json:"-" bson:"secret" graphql:"-"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt" graphql:"readonly"`
+	Tags      []string           `json:"tags" bson:"tags"`
+	Address   testAddress        `json:"address" bson:"address"`
+}
+
+func TestIsIDFieldAndIDFieldOf(t *testing.T) {
+	typ := reflect.TypeOf(testDoc{})
+	if !isIDField(typ.Field(0)) {
+		t.Fatalf("expected field 0 (_id) to be recognized as the ID field")
+	}
+	if isIDField(typ.Field(1)) {
+		t.Fatalf("did not expect field 1 (name) to be recognized as the ID field")
+	}
+	if got := idFieldOf(typ); got != "_id" {
+		t.Fatalf("idFieldOf() = %q, want %q", got, "_id")
+	}
+}
+
+func TestJsonName(t *testing.T) {
+	typ := reflect.TypeOf(testDoc{})
+	cases := []struct {
+		field int
+		want  string
+	}{
+		{0, "id"},
+		{1, "name"},
+	}
+	for _, c := range cases {
+		if got := jsonName(typ.Field(c.field)); got != c.want {
+			t.Errorf("jsonName(field %d) = %q, want %q", c.field, got, c.want)
+		}
+	}
+}
+
+func TestBsonName(t *testing.T) {
+	typ := reflect.TypeOf(testDoc{})
+	if got := bsonName(typ.Field(1)); got != "name" {
+		t.Errorf("bsonName(name) = %q, want %q", got, "name")
+	}
+}
+
+func TestRegistryInputTypeSkipsHiddenAndReadonlyAndIDFields(t *testing.T) {
+	r := NewRegistry()
+	in := r.inputTypeFor(reflect.TypeOf(testDoc{}))
+
+	fields := in.Fields()
+	for _, hidden := range []string{"id", "secret", "createdAt"} {
+		if _, ok := fields[hidden]; ok {
+			t.Errorf("expected %q to be excluded from the generated input type, but it was present", hidden)
+		}
+	}
+	for _, visible := range []string{"name", "tags", "address"} {
+		if _, ok := fields[visible]; !ok {
+			t.Errorf("expected %q to be present in the generated input type", visible)
+		}
+	}
+}
+
+func TestToBSONFilterCoercesNestedAndSliceValues(t *testing.T) {
+	args := map[string]interface{}{
+		"name": "book",
+		"tags": []interface{}{"a", "b"},
+		"address": map[string]interface{}{
+			"city": "nyc",
+		},
+	}
+
+	out := toBSONFilter(reflect.TypeOf(testDoc{}), args)
+
+	if out["name"] != "book" {
+		t.Errorf("out[name] = %v, want %q", out["name"], "book")
+	}
+	tags, ok := out["tags"].([]interface{})
+	if !ok || len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("out[tags] = %v, want [a b]", out["tags"])
+	}
+	address, ok := out["address"].(bson.M)
+	if !ok || address["city"] != "nyc" {
+		t.Errorf("out[address] = %v, want map[city:nyc]", out["address"])
+	}
+}
+
+func TestToBSONFilterSkipsHiddenFields(t *testing.T) {
+	out := toBSONFilter(reflect.TypeOf(testDoc{}), map[string]interface{}{"secret": "leaked"})
+	if _, ok := out["secret"]; ok {
+		t.Errorf("expected secret (graphql:\"-\") to be excluded from toBSONFilter output")
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// subscriptionType holds the generated Subscription root object once
+// buildSubscriptionType has run during init.
+var subscriptionType *graphql.Object
+
+// buildSubscriptionType assembles the Subscription root object. It takes
+// bookType as a parameter rather than referencing a package var directly
+// because bookType itself is only known once schemagen has built it
+// during init, after ordinary package-level var initializers have run.
+func buildSubscriptionType(bookType *graphql.Object) *graphql.Object {
+	subscriptionType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"bookAdded":   &graphql.Field{Type: bookType},
+				"bookUpdated": &graphql.Field{Type: bookType},
+				"bookDeleted": &graphql.Field{Type: bookType},
+			},
+		},
+	)
+	return subscriptionType
+}
+
+// mongoOpForField maps a subscription field to the change-stream
+// operationType it should watch.
+var mongoOpForField = map[string]string{
+	"bookAdded":   "insert",
+	"bookUpdated": "update",
+	"bookDeleted": "delete",
+}
+
+type subscriptionEvent struct {
+	book Book
+}
+
+// subscriptionHub shares a single MongoDB change stream per operation type
+// across every connected subscriber of that field, fanning each change out
+// to per-client channels instead of opening one stream per subscriber.
+type subscriptionHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan subscriptionEvent]struct{}
+	cancel      map[string]context.CancelFunc
+	// resumeTokens survives a field's watch goroutine stopping and later
+	// restarting (last subscriber left, a new one arrived before the next
+	// matching write), unlike a token local to watch itself.
+	resumeTokens map[string]bson.Raw
+}
+
+var hub = &subscriptionHub{
+	subscribers:  make(map[string]map[chan subscriptionEvent]struct{}),
+	cancel:       make(map[string]context.CancelFunc),
+	resumeTokens: make(map[string]bson.Raw),
+}
+
+func (h *subscriptionHub) subscribe(field string) chan subscriptionEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan subscriptionEvent, 16)
+	if h.subscribers[field] == nil {
+		h.subscribers[field] = make(map[chan subscriptionEvent]struct{})
+	}
+	h.subscribers[field][ch] = struct{}{}
+
+	if _, watching := h.cancel[field]; !watching {
+		ctx, cancel := context.WithCancel(context.Background())
+		h.cancel[field] = cancel
+		go h.watch(ctx, field)
+	}
+	return ch
+}
+
+// unsubscribe drops ch from field's subscribers and, if that was the last
+// one, cancels field's change-stream context so the watch goroutine's
+// blocked stream.Next returns immediately instead of waiting for the next
+// matching write (or forever, if there isn't one).
+func (h *subscriptionHub) unsubscribe(field string, ch chan subscriptionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[field], ch)
+	close(ch)
+
+	if len(h.subscribers[field]) == 0 {
+		if cancel, ok := h.cancel[field]; ok {
+			cancel()
+			delete(h.cancel, field)
+		}
+	}
+}
+
+func (h *subscriptionHub) publish(field string, evt subscriptionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[field] {
+		select {
+		case ch <- evt:
+		default:
+			log.Printf("subscriber channel for %s is full, dropping event", field)
+		}
+	}
+}
+
+// watch opens a change stream for field's operation type and keeps
+// re-opening it, resuming from h.resumeTokens[field], until ctx is
+// canceled (by unsubscribe, once field's last subscriber leaves). Passing
+// ctx into Watch and stream.Next, rather than context.Background(), is
+// what makes that cancellation take effect immediately instead of only
+// being noticed after the next matching write happens to unblock Next.
+func (h *subscriptionHub) watch(ctx context.Context, field string) {
+	opType := mongoOpForField[field]
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "operationType", Value: opType}}}},
+	}
+
+	for {
+		h.mu.Lock()
+		resumeToken := h.resumeTokens[field]
+		h.mu.Unlock()
+
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+
+		stream, err := booksCollection.Watch(ctx, pipeline, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("opening change stream for %s: %v", field, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for stream.Next(ctx) {
+			h.mu.Lock()
+			h.resumeTokens[field] = stream.ResumeToken()
+			h.mu.Unlock()
+
+			var event struct {
+				FullDocument Book `bson:"fullDocument"`
+				DocumentKey  struct {
+					ID primitive.ObjectID `bson:"_id"`
+				} `bson:"documentKey"`
+			}
+			if err := stream.Decode(&event); err != nil {
+				log.Printf("decoding change event for %s: %v", field, err)
+				continue
+			}
+
+			book := event.FullDocument
+			if opType == "delete" {
+				book = Book{ID: event.DocumentKey.ID}
+			}
+			h.publish(field, subscriptionEvent{book: book})
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			log.Printf("change stream for %s ended: %v", field, err)
+		}
+		stream.Close(context.Background())
+
+		if ctx.Err() != nil {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{"graphql-transport-ws"},
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type subscribePayload struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// wsClient owns one graphql-transport-ws connection. All writes go through
+// send so only writePump ever calls conn.WriteMessage, since gorilla's
+// websocket.Conn does not allow concurrent writers.
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc
+}
+
+func graphqlWSHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("websocket upgrade failed: %v", err)
+		return
+	}
+
+	client := &wsClient{
+		conn: conn,
+		send: make(chan []byte, 16),
+		subs: make(map[string]context.CancelFunc),
+	}
+	go client.writePump()
+	client.readPump()
+}
+
+func (c *wsClient) writePump() {
+	for msg := range c.send {
+		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return
+		}
+	}
+}
+
+func (c *wsClient) write(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("marshaling websocket frame: %v", err)
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		log.Printf("websocket send buffer full, dropping frame")
+	}
+}
+
+func (c *wsClient) writeError(id, message string) {
+	c.write(map[string]interface{}{
+		"id":      id,
+		"type":    "error",
+		"payload": []map[string]string{{"message": message}},
+	})
+}
+
+func (c *wsClient) readPump() {
+	defer func() {
+		c.mu.Lock()
+		for id, cancel := range c.subs {
+			cancel()
+			delete(c.subs, id)
+		}
+		c.mu.Unlock()
+		close(c.send)
+		c.conn.Close()
+	}()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.write(wsMessage{Type: "connection_error"})
+			continue
+		}
+
+		switch msg.Type {
+		case "connection_init":
+			c.write(wsMessage{Type: "connection_ack"})
+		case "ping":
+			c.write(wsMessage{Type: "pong"})
+		case "subscribe":
+			c.handleSubscribe(msg)
+		case "complete":
+			c.mu.Lock()
+			if cancel, ok := c.subs[msg.ID]; ok {
+				cancel()
+				delete(c.subs, msg.ID)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *wsClient) handleSubscribe(msg wsMessage) {
+	var payload subscribePayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		c.writeError(msg.ID, "invalid subscribe payload")
+		return
+	}
+
+	field, err := subscriptionField(payload.Query)
+	if err != nil {
+		c.writeError(msg.ID, err.Error())
+		return
+	}
+	if _, ok := subscriptionType.Fields()[field]; !ok {
+		c.writeError(msg.ID, fmt.Sprintf("unknown subscription field %q", field))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.subs[msg.ID] = cancel
+	c.mu.Unlock()
+
+	events := hub.subscribe(field)
+	go func() {
+		defer hub.unsubscribe(field, events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-events:
+				if !ok {
+					return
+				}
+				c.write(map[string]interface{}{
+					"id":   msg.ID,
+					"type": "next",
+					"payload": graphql.Result{
+						Data: map[string]interface{}{field: evt.book},
+					},
+				})
+			}
+		}
+	}()
+}
+
+// subscriptionField parses a subscription document and returns the single
+// root field it subscribes to.
+func subscriptionField(query string) (string, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return "", fmt.Errorf("parsing subscription query: %w", err)
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || op.Operation != "subscription" {
+			continue
+		}
+		for _, sel := range op.SelectionSet.Selections {
+			if field, ok := sel.(*ast.Field); ok {
+				return field.Name.Value, nil
+			}
+		}
+	}
+	return "", errors.New("no subscription field found in query")
+}